@@ -0,0 +1,45 @@
+package addrs
+
+import "fmt"
+
+// instanceKey represents the key of an instance within a module call or
+// resource block that has had count or for_each set. No key at all, for
+// a module call or resource that isn't using either of these features, is
+// represented by NoKey.
+type instanceKey interface {
+	instanceKeySigil()
+	String() string
+}
+
+// NoKey represents the absence of an instanceKey, for the common case
+// where a module call or resource has no count or for_each attribute set.
+var NoKey instanceKey
+
+// IntKey is the InstanceKey representation for addresses with indices,
+// like "module.foo[1]". This is the key type used when the module or
+// resource has the "count" argument set.
+type IntKey int
+
+func (k IntKey) instanceKeySigil() {}
+
+func (k IntKey) String() string {
+	return fmt.Sprintf("[%d]", int(k))
+}
+
+// StringKey is the InstanceKey representation for addresses with string
+// indices, like "module.foo[\"bar\"]". This is the key type used when the
+// module or resource has the "for_each" argument set.
+type StringKey string
+
+func (k StringKey) instanceKeySigil() {}
+
+func (k StringKey) String() string {
+	return fmt.Sprintf("[%q]", string(k))
+}
+
+// InstanceKey is the exported alias of instanceKey, allowing other packages
+// (such as the module/resource expansion logic in the terraform package) to
+// declare variables of this type and to construct IntKey/StringKey values
+// without needing to know about the lowercase sigil-only interface used
+// internally within this package.
+type InstanceKey = instanceKey
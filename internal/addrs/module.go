@@ -0,0 +1,81 @@
+package addrs
+
+import "strings"
+
+// Module is an address for a module call within the static module tree,
+// relative to the root of the configuration. It describes a position in
+// the tree of module calls as written in configuration, without regard to
+// the possibility that "count" or "for_each" might cause a call to produce
+// multiple instances.
+//
+// This is a static address: it identifies a module call in configuration,
+// not a node in the dynamic module tree produced by expanding "count" and
+// "for_each". For the latter, use ModuleInstance.
+type Module []string
+
+// RootModule is the module address for the root module, which is also the
+// zero value of Module.
+var RootModule Module
+
+// String returns a string representation of the receiver, using the same
+// dotted "module.name" syntax accepted by ParseModuleInstanceStr.
+func (m Module) String() string {
+	if len(m) == 0 {
+		return ""
+	}
+	return "module." + strings.Join([]string(m), ".module.")
+}
+
+// Child returns the address of a child call of the receiver, identified by
+// the given name.
+func (m Module) Child(name string) Module {
+	ret := make(Module, 0, len(m)+1)
+	ret = append(ret, m...)
+	return append(ret, name)
+}
+
+// Equal returns true if the receiver and the given other value represent
+// the same static module path.
+func (m Module) Equal(other Module) bool {
+	if len(m) != len(other) {
+		return false
+	}
+	for i := range m {
+		if m[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Ancestors returns a slice containing the receiver and all of its
+// ancestor modules, all the way up to (and including) the root module.
+// The result is ordered root-first, so the receiver is always the final
+// element.
+func (m Module) Ancestors() []Module {
+	ret := make([]Module, 0, len(m)+1)
+	for i := 0; i <= len(m); i++ {
+		ret = append(ret, m[:i])
+	}
+	return ret
+}
+
+// Parent returns the address of the module call that contains the
+// receiver, or the receiver itself if it is already the root module.
+func (m Module) Parent() Module {
+	if len(m) == 0 {
+		return m
+	}
+	return m[:len(m)-1]
+}
+
+// Call returns the address of the module that contains the receiver's
+// final call, along with a ModuleCall describing that call.
+// It panics if called on the root module, which is not the result of any
+// call.
+func (m Module) Call() (Module, ModuleCall) {
+	if len(m) == 0 {
+		panic("cannot call Call on the root module address")
+	}
+	return m.Parent(), ModuleCall{Name: m[len(m)-1]}
+}
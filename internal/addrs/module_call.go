@@ -0,0 +1,16 @@
+package addrs
+
+// ModuleCall is the address of a call from the containing module to a
+// child module.
+//
+// There is no separate "AbsModuleCall" type, because a ModuleCall is
+// always interpreted relative to the module instance doing the calling;
+// code that needs to resolve a ModuleCall to a concrete child module
+// instance should do so via the calling ModuleInstance's Child method.
+type ModuleCall struct {
+	Name string
+}
+
+func (c ModuleCall) String() string {
+	return "module." + c.Name
+}
@@ -142,12 +142,12 @@ func parseModuleInstancePrefix(traversal hcl.Traversal) (ModuleInstance, hcl.Tra
 
 				switch idx.Key.Type() {
 				case cty.String:
-					step.InstanceKey = stringKey(idx.Key.AsString())
+					step.InstanceKey = StringKey(idx.Key.AsString())
 				case cty.Number:
 					var idxInt int
 					err := gocty.FromCtyValue(idx.Key, &idxInt)
 					if err == nil {
-						step.InstanceKey = intKey(idxInt)
+						step.InstanceKey = IntKey(idxInt)
 					} else {
 						diags = diags.Append(&hcl.Diagnostic{
 							Severity: hcl.DiagError,
@@ -190,24 +190,6 @@ func parseModuleInstancePrefix(traversal hcl.Traversal) (ModuleInstance, hcl.Tra
 	return mi, retRemain, diags
 }
 
-// UnkeyedInstanceShim is a shim method for converting a Module address to the
-// equivalent ModuleInstance address that assumes that no modules have
-// keyed instances.
-//
-// This is a temporary allowance for the fact that Terraform does not presently
-// support "count" and "for_each" on modules, and thus graph building code that
-// derives graph nodes from configuration must just assume unkeyed modules
-// in order to construct the graph. At a later time when "count" and "for_each"
-// support is added for modules, all callers of this method will need to be
-// reworked to allow for keyed module instances.
-func (m Module) UnkeyedInstanceShim() ModuleInstance {
-	path := make(ModuleInstance, len(m))
-	for i, name := range m {
-		path[i] = ModuleInstanceStep{Name: name}
-	}
-	return path
-}
-
 // ModuleInstanceStep is a single traversal step through the dynamic module
 // tree. It is used only as part of ModuleInstance.
 type ModuleInstanceStep struct {
@@ -271,10 +253,10 @@ func (m ModuleInstance) TargetContains(other Targetable) bool {
 		// If we fall out here then the prefixed matched, so it's contained.
 		return true
 
-	case absResource:
+	case AbsResource:
 		return m.TargetContains(to.Module)
 
-	case absResourceInstance:
+	case AbsResourceInstance:
 		return m.TargetContains(to.Module)
 
 	default:
@@ -285,3 +267,50 @@ func (m ModuleInstance) TargetContains(other Targetable) bool {
 func (m ModuleInstance) targetableSigil() {
 	// ModuleInstance is targetable
 }
+
+// Equal returns true if the receiver and the given other value represent
+// the same module instance, including any instance keys.
+func (m ModuleInstance) Equal(other ModuleInstance) bool {
+	if len(m) != len(other) {
+		return false
+	}
+	for i := range m {
+		if m[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Ancestors returns a slice containing the receiver and all of its
+// ancestor module instances, all the way up to (and including) the root
+// module instance. The result is ordered root-first, so the receiver is
+// always the final element.
+func (m ModuleInstance) Ancestors() []ModuleInstance {
+	ret := make([]ModuleInstance, 0, len(m)+1)
+	for i := 0; i <= len(m); i++ {
+		ret = append(ret, m[:i])
+	}
+	return ret
+}
+
+// Parent returns the address of the module instance that contains the
+// receiver, or the receiver itself if it is already the root module
+// instance.
+func (m ModuleInstance) Parent() ModuleInstance {
+	if len(m) == 0 {
+		return m
+	}
+	return m[:len(m)-1]
+}
+
+// Call returns the address of the module instance that contains the
+// receiver's final call, along with a ModuleCall describing that call.
+// It panics if called on the root module instance, which is not the
+// result of any call.
+func (m ModuleInstance) Call() (ModuleInstance, ModuleCall) {
+	if len(m) == 0 {
+		panic("cannot call Call on the root module instance address")
+	}
+	return m.Parent(), ModuleCall{Name: m[len(m)-1].Name}
+}
@@ -0,0 +1,147 @@
+package addrs
+
+import "fmt"
+
+// Resource is an address for a resource block within configuration, which
+// contains potentially-multiple resource instances if that resource is
+// using "count" or "for_each".
+type Resource struct {
+	Type string
+	Name string
+}
+
+func (r Resource) String() string {
+	return fmt.Sprintf("%s.%s", r.Type, r.Name)
+}
+
+// Instance produces the address for a specific instance of the receiver
+// that is identified by the given key.
+func (r Resource) Instance(key instanceKey) ResourceInstance {
+	return ResourceInstance{
+		Resource: r,
+		Key:      key,
+	}
+}
+
+// Absolute returns an AbsResource from the receiver and the given module
+// instance address.
+func (r Resource) Absolute(module ModuleInstance) AbsResource {
+	return AbsResource{
+		Module:   module,
+		Resource: r,
+	}
+}
+
+// ResourceInstance is an address for a specific instance of a resource.
+// When a resource is defined in configuration with "count" or "for_each" it
+// produces zero or more instances, which can be addressed using this type.
+type ResourceInstance struct {
+	Resource Resource
+	Key      instanceKey
+}
+
+func (r ResourceInstance) String() string {
+	if r.Key == NoKey {
+		return r.Resource.String()
+	}
+	return r.Resource.String() + r.Key.String()
+}
+
+// Absolute returns an AbsResourceInstance from the receiver and the given
+// module instance address.
+func (r ResourceInstance) Absolute(module ModuleInstance) AbsResourceInstance {
+	return AbsResourceInstance{
+		Module:           module,
+		ResourceInstance: r,
+	}
+}
+
+// AbsResource is an absolute address for a resource under a given module
+// path.
+type AbsResource struct {
+	Module   ModuleInstance
+	Resource Resource
+}
+
+var _ Targetable = AbsResource{}
+
+func (r AbsResource) String() string {
+	if len(r.Module) == 0 {
+		return r.Resource.String()
+	}
+	return fmt.Sprintf("%s.%s", r.Module.String(), r.Resource.String())
+}
+
+// Instance produces the address for a specific instance of the receiver
+// that is identified by the given key.
+func (r AbsResource) Instance(key instanceKey) AbsResourceInstance {
+	return AbsResourceInstance{
+		Module:           r.Module,
+		ResourceInstance: r.Resource.Instance(key),
+	}
+}
+
+// Equal returns true if the receiver represents the same resource address
+// as the given other value.
+func (r AbsResource) Equal(other AbsResource) bool {
+	return r.Module.String() == other.Module.String() && r.Resource == other.Resource
+}
+
+// TargetContains implements Targetable.
+func (r AbsResource) TargetContains(other Targetable) bool {
+	switch to := other.(type) {
+	case AbsResource:
+		return r.Equal(to)
+	case AbsResourceInstance:
+		return r.Equal(to.ContainingResource())
+	default:
+		return false
+	}
+}
+
+func (r AbsResource) targetableSigil() {}
+
+// AbsResourceInstance is an absolute address for a resource instance under
+// a given module path.
+type AbsResourceInstance struct {
+	Module           ModuleInstance
+	ResourceInstance ResourceInstance
+}
+
+var _ Targetable = AbsResourceInstance{}
+
+func (r AbsResourceInstance) String() string {
+	if len(r.Module) == 0 {
+		return r.ResourceInstance.String()
+	}
+	return fmt.Sprintf("%s.%s", r.Module.String(), r.ResourceInstance.String())
+}
+
+// ContainingResource returns the address of the resource that the receiver
+// is an instance of.
+func (r AbsResourceInstance) ContainingResource() AbsResource {
+	return AbsResource{
+		Module:   r.Module,
+		Resource: r.ResourceInstance.Resource,
+	}
+}
+
+// Equal returns true if the receiver represents the same resource instance
+// address as the given other value.
+func (r AbsResourceInstance) Equal(other AbsResourceInstance) bool {
+	return r.Module.String() == other.Module.String() &&
+		r.ResourceInstance.Resource == other.ResourceInstance.Resource &&
+		r.ResourceInstance.Key == other.ResourceInstance.Key
+}
+
+// TargetContains implements Targetable.
+func (r AbsResourceInstance) TargetContains(other Targetable) bool {
+	switch to := other.(type) {
+	case AbsResourceInstance:
+		return r.Equal(to)
+	default:
+		return false
+	}
+}
+
+func (r AbsResourceInstance) targetableSigil() {}
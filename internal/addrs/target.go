@@ -0,0 +1,227 @@
+package addrs
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/internal/tfdiags"
+)
+
+// Targetable is an interface implemented by all address types that can be
+// used as the target of the -target command line option.
+//
+// The primary purpose of this interface, beyond identifying a "target"
+// address, is to implement TargetContains to decide whether one address
+// is encompassed by another, e.g. whether a resource instance is contained
+// within a module instance that was targeted directly.
+type Targetable interface {
+	// TargetContains returns true if the given other address is contained
+	// within, or equal to, the receiver.
+	TargetContains(other Targetable) bool
+
+	String() string
+
+	targetableSigil()
+}
+
+// ParseTarget interprets a given traversal as a targetable address, using
+// the same module-instance-prefix syntax understood by ParseModuleInstanceStr
+// and then, optionally, continuing on to parse a resource or resource
+// instance address within that module.
+//
+// The following are all valid target traversals:
+//
+//	module.foo
+//	module.foo["a"]
+//	module.foo[0].module.bar
+//	aws_instance.foo
+//	aws_instance.foo[2]
+//	module.foo["a"].aws_instance.bar[2]
+func ParseTarget(traversal hcl.Traversal) (Targetable, tfdiags.Diagnostics) {
+	path, remain, diags := parseModuleInstancePrefix(traversal)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	if len(remain) == 0 {
+		return path, diags
+	}
+
+	rAddr, moreDiags := parseResourceUnderModule(remain)
+	diags = diags.Append(moreDiags)
+	if moreDiags.HasErrors() {
+		return nil, diags
+	}
+
+	if rAddr.Key == NoKey {
+		return rAddr.Resource.Absolute(path), diags
+	}
+	return rAddr.Absolute(path), diags
+}
+
+// ParseTargetStr is a helper wrapper around ParseTarget that takes a string
+// and parses it with the HCL native syntax traversal parser before
+// interpreting it.
+//
+// This should be used only in specialized situations since it will cause
+// the created references to not have any meaningful source location
+// information. If a reference string is coming from a source that should
+// be identified in error messages then the caller should instead parse it
+// directly using a suitable function from the HCL API and pass the
+// traversal itself to ParseTarget.
+//
+// Error diagnostics are returned if either the parsing fails or the
+// analysis of the traversal fails. There is no way for the caller to
+// distinguish the two kinds of diagnostics programmatically. If error
+// diagnostics are returned then the returned target is invalid.
+func ParseTargetStr(str string) (Targetable, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+
+	traversal, parseDiags := hclsyntax.ParseTraversalAbs([]byte(str), "", hcl.Pos{Line: 1, Column: 1})
+	diags = diags.Append(parseDiags)
+	if parseDiags.HasErrors() {
+		return nil, diags
+	}
+
+	target, targetDiags := ParseTarget(traversal)
+	diags = diags.Append(targetDiags)
+	return target, diags
+}
+
+// ParseAbsResourceInstanceStr is a helper wrapper around ParseTargetStr that
+// requires the result to be a resource instance. A whole resource address
+// (one with no index) is accepted and returned as its NoKey instance; an
+// error diagnostic is returned if a module instance was given instead.
+func ParseAbsResourceInstanceStr(str string) (AbsResourceInstance, tfdiags.Diagnostics) {
+	target, diags := ParseTargetStr(str)
+	if diags.HasErrors() {
+		return AbsResourceInstance{}, diags
+	}
+
+	switch addr := target.(type) {
+	case AbsResourceInstance:
+		return addr, diags
+	case AbsResource:
+		return addr.Instance(NoKey), diags
+	default:
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   fmt.Sprintf("%q is not the address of a specific resource instance.", str),
+		})
+		return AbsResourceInstance{}, diags
+	}
+}
+
+// parseResourceUnderModule parses the "resource_type.name[key]" suffix that
+// may follow a module instance prefix within a target traversal, producing
+// a module-relative ResourceInstance. The caller is responsible for
+// combining the result with the module instance prefix that was already
+// consumed by parseModuleInstancePrefix.
+func parseResourceUnderModule(traversal hcl.Traversal) (ResourceInstance, tfdiags.Diagnostics) {
+	var diags tfdiags.Diagnostics
+	var resourceType, name string
+
+	switch tt := traversal[0].(type) {
+	case hcl.TraverseRoot:
+		resourceType = tt.Name
+	case hcl.TraverseAttr:
+		resourceType = tt.Name
+	default:
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   "A resource address must start with a resource type name.",
+			Subject:  traversal[0].SourceRange().Ptr(),
+		})
+		return ResourceInstance{}, diags
+	}
+	remain := traversal[1:]
+
+	if len(remain) == 0 {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   fmt.Sprintf("Resource type name %q must be followed by a resource name.", resourceType),
+			Subject:  traversal[0].SourceRange().Ptr(),
+		})
+		return ResourceInstance{}, diags
+	}
+
+	switch tt := remain[0].(type) {
+	case hcl.TraverseAttr:
+		name = tt.Name
+	default:
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   fmt.Sprintf("Resource type name %q must be followed by a resource name.", resourceType),
+			Subject:  remain[0].SourceRange().Ptr(),
+		})
+		return ResourceInstance{}, diags
+	}
+	remain = remain[1:]
+
+	resource := Resource{
+		Type: resourceType,
+		Name: name,
+	}
+
+	if len(remain) == 0 {
+		return resource.Instance(NoKey), diags
+	}
+
+	idx, ok := remain[0].(hcl.TraverseIndex)
+	if !ok {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   "The resource address is followed by additional invalid content.",
+			Subject:  remain[0].SourceRange().Ptr(),
+		})
+		return resource.Instance(NoKey), diags
+	}
+	remain = remain[1:]
+	if len(remain) != 0 {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   "The resource address is followed by additional invalid content.",
+			Subject:  remain[0].SourceRange().Ptr(),
+		})
+		return resource.Instance(NoKey), diags
+	}
+
+	var key instanceKey
+	switch idx.Key.Type() {
+	case cty.String:
+		key = StringKey(idx.Key.AsString())
+	case cty.Number:
+		var idxInt int
+		err := gocty.FromCtyValue(idx.Key, &idxInt)
+		if err != nil {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid address",
+				Detail:   fmt.Sprintf("Invalid resource index: %s.", err),
+				Subject:  idx.SourceRange().Ptr(),
+			})
+			return resource.Instance(NoKey), diags
+		}
+		key = IntKey(idxInt)
+	default:
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid address",
+			Detail:   "Invalid resource index: must be either a string or an integer.",
+			Subject:  idx.SourceRange().Ptr(),
+		})
+		return resource.Instance(NoKey), diags
+	}
+
+	return resource.Instance(key), diags
+}
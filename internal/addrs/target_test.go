@@ -0,0 +1,107 @@
+package addrs
+
+import (
+	"testing"
+)
+
+func TestParseTargetStr(t *testing.T) {
+	tests := map[string]struct {
+		Want Targetable
+	}{
+		"aws_instance.foo": {
+			Resource{Type: "aws_instance", Name: "foo"}.Instance(NoKey).Absolute(RootModuleInstance),
+		},
+		"aws_instance.foo[2]": {
+			Resource{Type: "aws_instance", Name: "foo"}.Instance(IntKey(2)).Absolute(RootModuleInstance),
+		},
+		"module.foo": {
+			ModuleInstance{{Name: "foo"}},
+		},
+		"module.foo[\"a\"]": {
+			ModuleInstance{{Name: "foo", InstanceKey: StringKey("a")}},
+		},
+		"module.foo[0].module.bar": {
+			ModuleInstance{
+				{Name: "foo", InstanceKey: IntKey(0)},
+				{Name: "bar"},
+			},
+		},
+		"module.foo[\"a\"].aws_instance.bar[2]": {
+			Resource{Type: "aws_instance", Name: "bar"}.Instance(IntKey(2)).Absolute(ModuleInstance{
+				{Name: "foo", InstanceKey: StringKey("a")},
+			}),
+		},
+	}
+
+	for str, test := range tests {
+		t.Run(str, func(t *testing.T) {
+			got, diags := ParseTargetStr(str)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors: %s", diags.Err())
+			}
+
+			if got.String() != test.Want.String() {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", got.String(), test.Want.String())
+			}
+
+			// Round-trip: parsing the String() form back out should
+			// produce an address with the same String() representation.
+			roundTripped, diags := ParseTargetStr(got.String())
+			if diags.HasErrors() {
+				t.Fatalf("unexpected errors round-tripping %q: %s", got.String(), diags.Err())
+			}
+			if roundTripped.String() != got.String() {
+				t.Errorf("round-trip mismatch\ngot:  %s\nwant: %s", roundTripped.String(), got.String())
+			}
+		})
+	}
+}
+
+func TestParseTargetStr_invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"module",
+		"aws_instance",
+		"module.foo.bar",
+	}
+
+	for _, str := range tests {
+		t.Run(str, func(t *testing.T) {
+			_, diags := ParseTargetStr(str)
+			if !diags.HasErrors() {
+				t.Fatalf("expected errors for %q, got none", str)
+			}
+		})
+	}
+}
+
+func TestParseAbsResourceInstanceStr(t *testing.T) {
+	t.Run("resource instance", func(t *testing.T) {
+		got, diags := ParseAbsResourceInstanceStr("aws_instance.foo[2]")
+		if diags.HasErrors() {
+			t.Fatalf("unexpected errors: %s", diags.Err())
+		}
+		want := "aws_instance.foo[2]"
+		if got.String() != want {
+			t.Errorf("wrong result\ngot:  %s\nwant: %s", got.String(), want)
+		}
+	})
+
+	t.Run("whole resource widens to NoKey instance", func(t *testing.T) {
+		got, diags := ParseAbsResourceInstanceStr("aws_instance.foo")
+		if diags.HasErrors() {
+			t.Fatalf("unexpected errors: %s", diags.Err())
+		}
+		want := "aws_instance.foo"
+		if got.String() != want {
+			t.Errorf("wrong result\ngot:  %s\nwant: %s", got.String(), want)
+		}
+	})
+
+	t.Run("module instance is rejected", func(t *testing.T) {
+		_, diags := ParseAbsResourceInstanceStr("module.foo")
+		if !diags.HasErrors() {
+			t.Fatalf("expected errors, got none")
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package configload
+
+import (
+	"sync"
+)
+
+// Cache is a content-addressed cache keyed by a module's static path
+// together with a content hash of its source files as recorded in a
+// Snapshot.
+//
+// It's used in three places: LoadConfigWithSnapshot caches the
+// *module.Tree produced by parsing a module's source; in the terraform
+// package, GraphNodeConfigModule's cachedTree caches the module's
+// *module.Tree, and its cachedGraph (used by Expand) caches the *Graph
+// built and transformed for each module instance. The graph cache is keyed
+// by the instance's own path, so a later expansion of the same instance
+// with unchanged content reuses its graph; distinct instances of a
+// "count" or "for_each" call are each built once.
+//
+// Cache stores values as interface{} rather than a single concrete type
+// because its callers live in different packages and cache different
+// kinds of value; callers are responsible for type-asserting what they
+// get back from Get.
+type Cache struct {
+	mu    sync.Mutex
+	items map[cacheKey]interface{}
+}
+
+type cacheKey struct {
+	modulePath string
+	hash       string
+}
+
+// NewCache creates an empty Cache.
+func NewCache() *Cache {
+	return &Cache{
+		items: make(map[cacheKey]interface{}),
+	}
+}
+
+// Get returns the cached value for the given module path and content
+// hash, if any, along with a boolean indicating whether it was found.
+func (c *Cache) Get(modulePath, hash string) (interface{}, bool) {
+	if hash == "" {
+		// An empty hash means the caller has no snapshot to key against,
+		// so we can't safely reuse a cached value.
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.items[cacheKey{modulePath, hash}]
+	return v, ok
+}
+
+// Put records the given value as the result of loading the module at the
+// given path with the given content hash.
+func (c *Cache) Put(modulePath, hash string, v interface{}) {
+	if hash == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[cacheKey{modulePath, hash}] = v
+}
@@ -0,0 +1,117 @@
+package configload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/terraform/config/module"
+)
+
+// Loader is responsible for producing Snapshots of module trees found on
+// disk, and for loading a *module.Tree back out of a previously-taken
+// Snapshot.
+//
+// This is the glue between the on-disk module tree that Terraform reads
+// during normal operation and the in-memory, content-addressed
+// representation used by Cache and (when serialized) stored alongside a
+// saved plan file so that a plan saved with "terraform plan -out=file" can
+// later be validated, at apply time, against the exact configuration it was
+// created from.
+type Loader struct {
+	// Cache is consulted (and populated) whenever LoadConfigWithSnapshot
+	// is asked to produce a *module.Tree for a module path that a
+	// snapshot has unchanged content for.
+	Cache *Cache
+}
+
+// NewLoader creates a Loader with a fresh, empty Cache.
+func NewLoader() *Loader {
+	return &Loader{
+		Cache: NewCache(),
+	}
+}
+
+// LoadSnapshot walks the given root module directory and produces a
+// Snapshot describing the content of every configuration file in the
+// module tree rooted there.
+//
+// Files directly in rootDir are recorded under the module path "root";
+// files in any subdirectory are recorded under "root." followed by that
+// directory's slash-separated path relative to rootDir (for example
+// "root.modules/foo"). Module call names are not consulted, so a key equals
+// a "."-joined graph path such as "root.foo" only when that module's files
+// sit in a directory named after its call directly under rootDir.
+//
+// This does not parse the configuration files; it only captures their raw
+// bytes, keyed by module path, so that the result can be hashed and later
+// compared against what's on disk (see EvalValidateSnapshot in the
+// terraform package) without needing to re-parse anything.
+func (l *Loader) LoadSnapshot(rootDir string) (*Snapshot, error) {
+	snap := NewSnapshot()
+
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".tf" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(rootDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		modulePath := "root"
+		if rel != "." {
+			modulePath = "root." + filepath.ToSlash(rel)
+		}
+
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %s", path, err)
+		}
+
+		if snap.Modules[modulePath] == nil {
+			snap.Modules[modulePath] = make(map[string][]byte)
+		}
+		snap.Modules[modulePath][filepath.Base(path)] = src
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+// LoadConfigWithSnapshot loads the module tree rooted at rootDir, using
+// the given Snapshot (typically one previously produced by LoadSnapshot
+// and persisted alongside a plan file) as a content-addressed cache key:
+// if the snapshot's content hash for the "root" module path matches an
+// entry already in the cache, the previously-parsed *module.Tree is reused
+// rather than re-parsed. The hash is taken from the given Snapshot, not
+// recomputed from the files currently on disk.
+//
+// The caller must still supply a real module.Tree loader function because
+// this package does not itself implement HCL parsing; it only adds a
+// caching layer in front of one.
+func (l *Loader) LoadConfigWithSnapshot(rootDir string, snap *Snapshot, load func(dir string) (*module.Tree, error)) (*module.Tree, error) {
+	modulePath := "root"
+	hash := snap.Hash(modulePath)
+
+	if cached, ok := l.Cache.Get(modulePath, hash); ok {
+		if tree, ok := cached.(*module.Tree); ok {
+			return tree, nil
+		}
+	}
+
+	tree, err := load(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	l.Cache.Put(modulePath, hash, tree)
+	return tree, nil
+}
@@ -0,0 +1,64 @@
+package configload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/config/module"
+)
+
+// TestLoaderCacheRoundTrip exercises LoadSnapshot and LoadConfigWithSnapshot
+// together to confirm that the module path LoadSnapshot uses to key a
+// Snapshot's Modules map is the same one LoadConfigWithSnapshot uses to
+// query it: if these two ever drift apart again, Hash would always return
+// "" and Get/Put would silently stop caching anything, which is exactly
+// the regression this test guards against.
+func TestLoaderCacheRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configload")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(`# root module`), 0644); err != nil {
+		t.Fatalf("failed to write fixture: %s", err)
+	}
+
+	loader := NewLoader()
+
+	snap, err := loader.LoadSnapshot(dir)
+	if err != nil {
+		t.Fatalf("unexpected error from LoadSnapshot: %s", err)
+	}
+
+	if hash := snap.Hash("root"); hash == "" {
+		t.Fatalf("snapshot has no hash for module path %q; LoadSnapshot's keys may not match LoadConfigWithSnapshot's", "root")
+	}
+
+	loadCalls := 0
+	load := func(loadDir string) (*module.Tree, error) {
+		loadCalls++
+		return new(module.Tree), nil
+	}
+
+	first, err := loader.LoadConfigWithSnapshot(dir, snap, load)
+	if err != nil {
+		t.Fatalf("unexpected error from first LoadConfigWithSnapshot: %s", err)
+	}
+	if loadCalls != 1 {
+		t.Fatalf("wrong number of load calls after first call: got %d, want 1", loadCalls)
+	}
+
+	second, err := loader.LoadConfigWithSnapshot(dir, snap, load)
+	if err != nil {
+		t.Fatalf("unexpected error from second LoadConfigWithSnapshot: %s", err)
+	}
+	if loadCalls != 1 {
+		t.Fatalf("second LoadConfigWithSnapshot call should have been served from cache, but load was called again (now %d times)", loadCalls)
+	}
+	if second != first {
+		t.Fatalf("second LoadConfigWithSnapshot call returned a different *module.Tree than the first; cache did not hit")
+	}
+}
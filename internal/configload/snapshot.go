@@ -0,0 +1,71 @@
+// Package configload implements a content-addressed, in-memory
+// representation of a module tree's source files, so that repeated graph
+// expansions of the same subtree (as produced by, for example, "count" or
+// "for_each" on a module call) do not need to re-read and re-parse the
+// same configuration files from disk over and over.
+package configload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// Snapshot is a content-addressed, in-memory representation of the full
+// set of source files that make up a module tree, as it was found on disk
+// (or in a module package) at the time the snapshot was taken.
+//
+// A Snapshot can be serialized to disk alongside a saved plan file so
+// that a later "apply" of that plan can be validated against the exact
+// configuration that produced it; see EvalValidateSnapshot in the
+// terraform package.
+type Snapshot struct {
+	// Modules maps a module path string ("root" for the root module; see
+	// Loader.LoadSnapshot for how other keys are formed) to the raw source
+	// of each of its configuration files, keyed by filename.
+	Modules map[string]map[string][]byte
+}
+
+// NewSnapshot creates an empty Snapshot, ready to have modules added to it
+// via AddModule.
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Modules: make(map[string]map[string][]byte),
+	}
+}
+
+// AddModule records the given set of source files as the content of the
+// module at the given path, replacing any previously-recorded content for
+// that path.
+func (s *Snapshot) AddModule(modulePath string, files map[string][]byte) {
+	s.Modules[modulePath] = files
+}
+
+// Hash returns a content hash of the given module's source files, suitable
+// for use as a cache key: two snapshots of the same module with identical
+// file contents (regardless of how they were loaded) produce the same
+// hash.
+//
+// An empty string is returned if the snapshot has no record of the given
+// module path.
+func (s *Snapshot) Hash(modulePath string) string {
+	files, ok := s.Modules[modulePath]
+	if !ok {
+		return ""
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write(files[name])
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
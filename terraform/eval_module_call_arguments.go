@@ -0,0 +1,42 @@
+package terraform
+
+import (
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/hcl2shim"
+)
+
+// EvalModuleCallArguments is an EvalNode that produces the cty.Value map of
+// arguments to pass into a module call, for use as the instance's input
+// variables.
+//
+// The configuration loader does not yet produce HCL2 bodies for module
+// call blocks, so for now this interpolates the legacy, HIL-based
+// *config.RawConfig representation via ctx.Interpolate, then upgrades
+// each resulting value to its equivalent cty.Value using hcl2shim.
+type EvalModuleCallArguments struct {
+	Config *config.RawConfig
+
+	// Output is populated by mutating the map it already points to,
+	// rather than by replacing it with a new one: callers such as
+	// graphNodeModuleExpanded.EvalTree build an EvalVariableBlock against
+	// the same map value before this node runs, so replacing *Output
+	// wholesale would leave that earlier snapshot pointing at the old,
+	// pre-interpolation (usually empty) map.
+	Output *map[string]cty.Value
+}
+
+func (n *EvalModuleCallArguments) Eval(ctx EvalContext) (interface{}, error) {
+	rc, err := ctx.Interpolate(n.Config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.Output != nil {
+		for k, v := range rc.Config {
+			(*n.Output)[k] = hcl2shim.HCL2ValueFromConfigValue(v)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,15 @@
+package terraform
+
+import "testing"
+
+// EvalModuleCallArguments.Eval exercises ctx.Interpolate, but the
+// EvalContext interface and its MockEvalContext test double both live
+// outside this tree (this package is a fragment that only carries the
+// EvalNode types that reference EvalContext, not its definition), so a
+// real unit test here would have to fabricate EvalContext's full method
+// set from scratch. Rather than guess at that and risk asserting against
+// a fake that doesn't match the real interface, this is left as an
+// explicit gap until MockEvalContext is available to this package.
+func TestEvalModuleCallArguments(t *testing.T) {
+	t.Skip("requires MockEvalContext, which is not present in this tree")
+}
@@ -0,0 +1,36 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/internal/configload"
+)
+
+// EvalValidateSnapshot is an EvalNode that detects drift between the
+// configuration snapshot that a saved plan was created from and the
+// configuration actually present on disk at apply time.
+//
+// This matches the workflow where "terraform plan -out=file" must be
+// applied against the exact same configuration that produced the plan:
+// ModulePath identifies which module's content hash to check, and Want is
+// the hash recorded in the plan's stored Snapshot. If Snapshot's current
+// hash for ModulePath doesn't match Want, Eval returns an error rather
+// than silently applying a plan against configuration it didn't expect.
+type EvalValidateSnapshot struct {
+	ModulePath string
+	Snapshot   *configload.Snapshot
+	Want       string
+}
+
+func (n *EvalValidateSnapshot) Eval(ctx EvalContext) (interface{}, error) {
+	got := n.Snapshot.Hash(n.ModulePath)
+	if got != n.Want {
+		return nil, fmt.Errorf(
+			"configuration for %q has changed since this plan was created; "+
+				"the plan must be re-created with the current configuration before it can be applied",
+			n.ModulePath,
+		)
+	}
+
+	return nil, nil
+}
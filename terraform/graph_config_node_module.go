@@ -2,12 +2,18 @@ package terraform
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/config/module"
 	"github.com/hashicorp/terraform/dag"
 	"github.com/hashicorp/terraform/dot"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/internal/addrs"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/internal/configload"
 )
 
 // GraphNodeConfigModule represents a module within the configuration graph.
@@ -15,6 +21,60 @@ type GraphNodeConfigModule struct {
 	Path   []string
 	Module *config.Module
 	Tree   *module.Tree
+
+	// RawCount and RawForEach hold the module call's "count" and
+	// "for_each" meta-argument expressions, if set. At most one of these
+	// is expected to be non-nil at a time. These live here rather than on
+	// *config.Module because config.Module comes from a package this repo
+	// doesn't own and doesn't parse count/for_each for module calls; it
+	// is the configuration loader's responsibility to populate these
+	// fields from the module call block before handing the node off to
+	// the graph builder.
+	RawCount   *config.RawConfig
+	RawForEach *config.RawConfig
+
+	// Snapshot and Cache are both optional. When both are set, Expand
+	// consults Cache (keyed by each instance's path and the content hash
+	// recorded in Snapshot for this module) before asking the GraphBuilder
+	// to rebuild that instance's subgraph, so that expanding the same
+	// module call again with unchanged configuration does not re-parse and
+	// re-transform it. Each distinct instance is still built once.
+	Snapshot *configload.Snapshot
+	Cache    *configload.Cache
+
+	// WantSnapshotHash, if non-empty, is the content hash that was
+	// recorded for this module when a saved plan was created. If set, the
+	// expanded module's EvalTree checks it against Snapshot's current
+	// hash for this module during apply, so that a saved plan can't
+	// silently be applied against configuration that has changed since
+	// the plan was made.
+	WantSnapshotHash string
+}
+
+// cachedTree returns the *module.Tree that should be used to build this
+// module's subgraph: either n.Tree directly, or a tree previously cached
+// for the same module path and content hash, whichever was loaded first.
+func (n *GraphNodeConfigModule) cachedTree() *module.Tree {
+	if n.Snapshot == nil || n.Cache == nil {
+		return n.Tree
+	}
+
+	// n.Path joined with "." gives "root", "root.<call name>", ..., the
+	// "root"-prefixed form that configload.Loader keys its Snapshot by
+	// (see LoadSnapshot for when a child module's key matches); n.Name()
+	// instead returns a dag vertex label like "module.foo", which the
+	// loader never produces, so using it here always missed the cache.
+	modulePath := strings.Join(n.Path, ".")
+	hash := n.Snapshot.Hash(modulePath)
+
+	if cached, ok := n.Cache.Get(modulePath, hash); ok {
+		if tree, ok := cached.(*module.Tree); ok {
+			return tree
+		}
+	}
+
+	n.Cache.Put(modulePath, hash, n.Tree)
+	return n.Tree
 }
 
 func (n *GraphNodeConfigModule) ConfigType() GraphNodeConfigType {
@@ -22,7 +82,7 @@ func (n *GraphNodeConfigModule) ConfigType() GraphNodeConfigType {
 }
 
 func (n *GraphNodeConfigModule) DependableName() []string {
-	config := n.Tree.Config()
+	config := n.cachedTree().Config()
 
 	result := make([]string, 1, len(config.Outputs)+1)
 	result[0] = n.Name()
@@ -51,33 +111,224 @@ func (n *GraphNodeConfigModule) Name() string {
 
 // GraphNodeExpandable
 func (n *GraphNodeConfigModule) Expand(b GraphBuilder) (GraphNodeSubgraph, error) {
-	// Build the graph first
-	graph, err := b.Build(n.Path)
+	keys, err := n.expandInstanceKeys()
 	if err != nil {
 		return nil, err
 	}
 
-	// Add the parameters node to the module
-	t := &ModuleInputTransformer{Variables: make(map[string]string)}
-	if err := t.Transform(graph); err != nil {
-		return nil, err
+	instances := make([]*graphNodeModuleInstanceExpanded, len(keys))
+	for i, key := range keys {
+		// Build the graph first, anchored to a path that's unique to this
+		// instance. Without this, every instance of a "count"/"for_each"
+		// module call would share the same Graph.Path, and so would read
+		// and write the same state/diff address as every other instance.
+		keyedPath := n.instancePath(key)
+		graph, err := n.cachedGraph(b, keyedPath)
+		if err != nil {
+			return nil, err
+		}
+
+		// Add the parameters node to the module. ModuleInputTransformer
+		// now threads through the module call arguments as cty.Value
+		// rather than strings, so that rich types (lists, maps, objects)
+		// can be passed into the module as input variables.
+		t := &ModuleInputTransformer{Variables: make(map[string]cty.Value)}
+		if err := t.Transform(graph); err != nil {
+			return nil, err
+		}
+
+		instances[i] = &graphNodeModuleInstanceExpanded{
+			Key:       key,
+			Graph:     graph,
+			Variables: t.Variables,
+		}
 	}
 
 	// Build the actual subgraph node
 	return &graphNodeModuleExpanded{
-		Original:    n,
-		Graph:       graph,
-		InputConfig: n.Module.RawConfig,
-		Variables:   t.Variables,
+		Original:         n,
+		Path:             n.Path,
+		Instances:        instances,
+		InputConfig:      n.Module.RawConfig,
+		Snapshot:         n.Snapshot,
+		WantSnapshotHash: n.WantSnapshotHash,
 	}, nil
 }
 
+// expandInstanceKeys evaluates the module call's "count" and "for_each"
+// arguments (if any) and returns the set of instance keys that the module
+// call should be expanded into. A module call with neither argument expands
+// to a single instance with addrs.NoKey, matching the historical behavior
+// that used to be hard-coded via addrs.Module.UnkeyedInstanceShim.
+func (n *GraphNodeConfigModule) expandInstanceKeys() ([]addrs.InstanceKey, error) {
+	switch {
+	case n.RawCount != nil && !n.RawCount.Empty():
+		count, err := n.RawCount.Int()
+		if err != nil {
+			return nil, fmt.Errorf("invalid count for module %q: %s", n.Module.Name, err)
+		}
+
+		keys := make([]addrs.InstanceKey, count)
+		for i := range keys {
+			keys[i] = addrs.IntKey(i)
+		}
+		return keys, nil
+
+	case n.RawForEach != nil && !n.RawForEach.Empty():
+		forEach, err := n.RawForEach.StringMap()
+		if err != nil {
+			return nil, fmt.Errorf("invalid for_each for module %q: %s", n.Module.Name, err)
+		}
+
+		// Map iteration order is randomized, so we need to sort the keys
+		// before assigning instances to them; otherwise the order that
+		// instances are added to the merged graph would be nondeterministic
+		// across runs of the same configuration.
+		names := make([]string, 0, len(forEach))
+		for k := range forEach {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		keys := make([]addrs.InstanceKey, len(names))
+		for i, k := range names {
+			keys[i] = addrs.StringKey(k)
+		}
+		return keys, nil
+
+	default:
+		return []addrs.InstanceKey{addrs.NoKey}, nil
+	}
+}
+
+// cachedGraph builds the subgraph for the given instance path, reusing a
+// previously-built *Graph from Cache when Snapshot's content hash for
+// this module hasn't changed since it was cached, instead of always
+// asking the GraphBuilder to reload and re-transform the module subtree
+// from scratch. This is what actually makes repeated expansions of the
+// same "count"/"for_each" module call cheap; cachedTree's use of
+// Cache only serves the unrelated, read-only DependableName/ProvidedBy
+// metadata queries.
+func (n *GraphNodeConfigModule) cachedGraph(b GraphBuilder, keyedPath []string) (*Graph, error) {
+	if n.Snapshot == nil || n.Cache == nil {
+		return b.Build(keyedPath)
+	}
+
+	// Prefixed so that an unkeyed instance, whose keyedPath equals n.Path,
+	// doesn't share cachedTree's entry for the same module path and hash.
+	cacheKey := "graph:" + strings.Join(keyedPath, ".")
+	// Hashed by n.Path (this call's own, un-instanced module path), not
+	// keyedPath: the snapshot only has one content hash per module source
+	// directory, shared across every instance of a "count"/"for_each"
+	// call, and it's keyed in configload.Loader's "root"-prefixed format
+	// rather than dag.VertexName's "module.<call name>".
+	hash := n.Snapshot.Hash(strings.Join(n.Path, "."))
+
+	if cached, ok := n.Cache.Get(cacheKey, hash); ok {
+		if graph, ok := cached.(*Graph); ok {
+			return graph, nil
+		}
+	}
+
+	graph, err := b.Build(keyedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Cache.Put(cacheKey, hash, graph)
+	return graph, nil
+}
+
+// instancePath returns the Graph path that should be used to build the
+// subgraph for the given instance key: n.Path, with the key (if any)
+// appended to its final element so that each instance of a "count" or
+// "for_each" module call gets a distinct path for state/diff addressing,
+// e.g. ["root", "foo"] and ["root", "foo[1]"] rather than both using
+// ["root", "foo"].
+func (n *GraphNodeConfigModule) instancePath(key addrs.InstanceKey) []string {
+	if key == addrs.NoKey || len(n.Path) == 0 {
+		return n.Path
+	}
+
+	path := make([]string, len(n.Path))
+	copy(path, n.Path)
+	path[len(path)-1] += key.String()
+	return path
+}
+
+// GraphNodeTargetable impl.
+func (n *GraphNodeConfigModule) TargetableAddrs() []addrs.Targetable {
+	keys, err := n.expandInstanceKeys()
+	if err != nil {
+		// expandInstanceKeys only fails on an invalid count/for_each
+		// expression, which would already have failed validation earlier
+		// in the graph walk; treat the module call as untargetable rather
+		// than panicking here.
+		return nil
+	}
+
+	callPath := addrs.Module(n.Path[1:])
+
+	result := make([]addrs.Targetable, 0, len(keys))
+	for _, key := range keys {
+		inst := make(addrs.ModuleInstance, len(callPath))
+		for i, seg := range callPath {
+			// Any ancestor segment here may have had an instance key
+			// baked into its text by instancePath when an enclosing
+			// module call expanded this one's parent, so we have to
+			// split it back out rather than treating the whole segment
+			// as a literal Name. Otherwise the result wouldn't compare
+			// equal, under ModuleInstance.TargetContains, to the same
+			// address as produced by parsing target syntax such as
+			// "module.foo[0].module.bar".
+			name, segKey := splitInstancePathSegment(seg)
+			inst[i] = addrs.ModuleInstanceStep{Name: name, InstanceKey: segKey}
+		}
+		if len(inst) > 0 {
+			// The final segment is this module call's own name, given
+			// unkeyed in n.Path; the instance we're building the address
+			// for is keyed by the instance key being iterated here.
+			inst[len(inst)-1].InstanceKey = key
+		}
+		result = append(result, inst)
+	}
+	return result
+}
+
+// splitInstancePathSegment reverses instancePath's encoding of an
+// instance key into a Graph.Path segment, splitting e.g. "foo[0]" back
+// into ("foo", addrs.IntKey(0)) or "foo[\"a\"]" into ("foo",
+// addrs.StringKey("a")). A segment with no recognizable key suffix is
+// returned unchanged with addrs.NoKey.
+func splitInstancePathSegment(seg string) (string, addrs.InstanceKey) {
+	if !strings.HasSuffix(seg, "]") {
+		return seg, addrs.NoKey
+	}
+
+	i := strings.LastIndexByte(seg, '[')
+	if i < 0 {
+		return seg, addrs.NoKey
+	}
+
+	name := seg[:i]
+	inner := seg[i+1 : len(seg)-1]
+
+	if n, err := strconv.Atoi(inner); err == nil {
+		return name, addrs.IntKey(n)
+	}
+	if s, err := strconv.Unquote(inner); err == nil {
+		return name, addrs.StringKey(s)
+	}
+
+	return seg, addrs.NoKey
+}
+
 // GraphNodeExpandable
 func (n *GraphNodeConfigModule) ProvidedBy() []string {
 	// Build up the list of providers by simply going over our configuration
 	// to find the providers that are configured there as well as the
 	// providers that the resources use.
-	config := n.Tree.Config()
+	config := n.cachedTree().Config()
 	providers := make(map[string]struct{})
 	for _, p := range config.ProviderConfigs {
 		providers[p.Name] = struct{}{}
@@ -96,18 +347,38 @@ func (n *GraphNodeConfigModule) ProvidedBy() []string {
 	return result
 }
 
+// graphNodeModuleInstanceExpanded is a single expanded instance of a module
+// call. When a module call has "count" or "for_each" set, Expand produces
+// one of these per resulting addrs.InstanceKey; otherwise there is exactly
+// one instance, keyed by addrs.NoKey.
+type graphNodeModuleInstanceExpanded struct {
+	Key       addrs.InstanceKey
+	Graph     *Graph
+	Variables map[string]cty.Value
+}
+
 // graphNodeModuleExpanded represents a module where the graph has
-// been expanded. It stores the graph of the module as well as a reference
-// to the map of variables.
+// been expanded. It stores the graph of each resolved instance of the
+// module call as well as a reference to the map of variables for each.
 type graphNodeModuleExpanded struct {
-	Original    dag.Vertex
-	Graph       *Graph
+	Original dag.Vertex
+
+	// Path is the static module path that was expanded, i.e. the
+	// GraphNodeConfigModule's own Path before any instance key was
+	// appended to build each instance's subgraph. It's unaffected by how
+	// many instances the module call actually expanded to, so it's what
+	// Subgraph uses to give the merged graph a path.
+	Path []string
+
+	Instances   []*graphNodeModuleInstanceExpanded
 	InputConfig *config.RawConfig
 
-	// Variables is a map of the input variables. This reference should
-	// be shared with ModuleInputTransformer in order to create a connection
-	// where the variables are set properly.
-	Variables map[string]string
+	// Snapshot and WantSnapshotHash are carried over from the originating
+	// GraphNodeConfigModule so that EvalTree can validate, during apply,
+	// that configuration hasn't drifted since a saved plan was created.
+	// Both are optional; EvalTree skips the check when either is unset.
+	Snapshot         *configload.Snapshot
+	WantSnapshotHash string
 }
 
 func (n *graphNodeModuleExpanded) Name() string {
@@ -128,76 +399,106 @@ func (n *graphNodeModuleExpanded) DotNode(name string, opts *GraphDotOpts) *dot.
 
 // GraphNodeEvalable impl.
 func (n *graphNodeModuleExpanded) EvalTree() EvalNode {
-	var resourceConfig *ResourceConfig
-	return &EvalSequence{
-		Nodes: []EvalNode{
-			&EvalInterpolate{
-				Config: n.InputConfig,
-				Output: &resourceConfig,
+	nodes := make([]EvalNode, 0, len(n.Instances)+1)
+
+	if n.Snapshot != nil && n.WantSnapshotHash != "" {
+		nodes = append(nodes, &EvalOpFilter{
+			Ops: []walkOperation{walkApply},
+			Node: &EvalValidateSnapshot{
+				// n.Path, not dag.VertexName(n.Original): the snapshot is
+				// keyed by configload.Loader's "root"-prefixed module
+				// path format, not by the "module.<call name>" vertex
+				// label, so using the latter here meant this check was
+				// always comparing "" == "" and could never fail.
+				ModulePath: strings.Join(n.Path, "."),
+				Snapshot:   n.Snapshot,
+				Want:       n.WantSnapshotHash,
 			},
+		})
+	}
 
-			&EvalVariableBlock{
-				Config:    &resourceConfig,
-				Variables: n.Variables,
-			},
+	for _, instance := range n.Instances {
+		nodes = append(nodes, &EvalSequence{
+			Nodes: []EvalNode{
+				&EvalModuleCallArguments{
+					Config: n.InputConfig,
+					Output: &instance.Variables,
+				},
+
+				&EvalVariableBlock{
+					Variables: instance.Variables,
+				},
 
-			&EvalOpFilter{
-				Ops: []walkOperation{walkPlanDestroy},
-				Node: &EvalSequence{
-					Nodes: []EvalNode{
-						&EvalDiffDestroyModule{Path: n.Graph.Path},
+				&EvalOpFilter{
+					Ops: []walkOperation{walkPlanDestroy},
+					Node: &EvalSequence{
+						Nodes: []EvalNode{
+							&EvalDiffDestroyModule{Path: instance.Graph.Path},
+						},
 					},
 				},
 			},
-		},
+		})
 	}
+
+	return &EvalSequence{Nodes: nodes}
 }
 
 // GraphNodeFlattenable impl.
 func (n *graphNodeModuleExpanded) FlattenGraph() *Graph {
-	graph := n.Subgraph()
-
-	// Build the string that represents the path. We do this once here
-	// so that we only have to compute it once. The block below is in {}
-	// so that parts drops out of scope immediately.
-	var pathStr string
-	{
-		parts := make([]string, 0, len(graph.Path)*2)
-		for _, p := range graph.Path[1:] {
-			parts = append(parts, "module", p)
+	merged := n.Subgraph()
+
+	for _, instance := range n.Instances {
+		graph := instance.Graph
+
+		// graph.Path's final element already has this instance's key (if
+		// any) baked into it by GraphNodeConfigModule.instancePath, so
+		// e.g. "module.foo[0].module.bar[\"a\"]" is already distinguishable
+		// from "module.foo[1].module.bar[\"a\"]" without appending
+		// instance.Key again here.
+		modPath := addrs.Module(graph.Path[1:])
+		pathStr := modPath.String()
+
+		// Go over each vertex in the graph and wrap the configuration
+		// items so that the dependencies properly map to the modules.
+		// See the docs for graphNodeModuleWrappable for more info.
+		for _, v := range graph.Vertices() {
+			if sn, ok := v.(graphNodeModuleSkippable); ok && sn.FlattenSkip() {
+				graph.Remove(v)
+				continue
+			}
+
+			wn, ok := v.(graphNodeModuleWrappable)
+			if !ok {
+				panic("unwrappable node: " + dag.VertexName(v))
+			}
+
+			graph.Replace(v, &graphNodeModuleFlatWrap{
+				graphNodeModuleWrappable: wn,
+
+				Path:       graph.Path,
+				PathString: pathStr,
+			})
 		}
 
-		pathStr = strings.Join(parts, ".")
-	}
-
-	// Go over each vertex in the graph and wrap the configuration
-	// items so that the dependencies properly map to the modules.
-	// See the docs for graphNodeModuleWrappable for more info.
-	for _, v := range graph.Vertices() {
-		if sn, ok := v.(graphNodeModuleSkippable); ok && sn.FlattenSkip() {
-			graph.Remove(v)
-			continue
+		for _, v := range graph.Vertices() {
+			merged.Add(v)
 		}
-
-		wn, ok := v.(graphNodeModuleWrappable)
-		if !ok {
-			panic("unwrappable node: " + dag.VertexName(v))
+		for _, e := range graph.Edges() {
+			merged.Connect(e)
 		}
-
-		graph.Replace(v, &graphNodeModuleFlatWrap{
-			graphNodeModuleWrappable: wn,
-
-			Path:       graph.Path,
-			PathString: pathStr,
-		})
 	}
 
-	return graph
+	return merged
 }
 
 // GraphNodeSubgraph impl.
 func (n *graphNodeModuleExpanded) Subgraph() *Graph {
-	return n.Graph
+	// The merged graph represents the module call as a whole, not any one
+	// instance of it -- each instance keeps its own distinct path on its
+	// vertices via graphNodeModuleFlatWrap -- so we use the static,
+	// un-keyed module path here rather than borrowing an instance's path.
+	return &Graph{Path: n.Path}
 }
 
 // This interface can be implemented to be skipped/ignored when
@@ -225,3 +526,13 @@ type graphNodeModuleFlatWrap struct {
 func (n *graphNodeModuleFlatWrap) Name() string {
 	return fmt.Sprintf("%s.%s", n.PathString, n.graphNodeModuleWrappable.Name())
 }
+
+// GraphNodeTargetable impl, delegating to the wrapped node when it's
+// targetable so that -target continues to work after FlattenGraph wraps
+// the vertex.
+func (n *graphNodeModuleFlatWrap) TargetableAddrs() []addrs.Targetable {
+	if tn, ok := n.graphNodeModuleWrappable.(GraphNodeTargetable); ok {
+		return tn.TargetableAddrs()
+	}
+	return nil
+}
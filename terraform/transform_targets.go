@@ -0,0 +1,88 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/dag"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/internal/addrs"
+)
+
+// GraphNodeTargetable is implemented by graph nodes that can be matched
+// against the addresses produced by addrs.ParseTarget, so that
+// TargetsTransformer can decide whether a particular -target argument
+// applies to them.
+type GraphNodeTargetable interface {
+	// TargetableAddrs returns the addresses that this vertex is
+	// responsible for, so that they can be compared against the
+	// requested target addresses. Most nodes return exactly one address,
+	// but some (such as a module call that expands into several
+	// instances) may return more than one.
+	TargetableAddrs() []addrs.Targetable
+}
+
+// TargetsTransformer is a GraphTransformer that, when Targets is
+// non-empty, prunes every vertex whose address is not contained by one of
+// the given target addresses.
+//
+// Targets are parsed with addrs.ParseTargetStr, so they may refer to whole
+// module instances, whole resources, or individual keyed resource
+// instances, e.g. "module.foo[\"a\"].aws_instance.bar[2]".
+//
+// TargetsTransformer does not append itself to any GraphBuilder's
+// transform list; whatever constructs the plan/apply GraphBuilder is
+// responsible for appending &TargetsTransformer{Targets: ...} (after the
+// module-expansion transforms, so that GraphNodeConfigModule and
+// graphNodeModuleFlatWrap's GraphNodeTargetable implementations have
+// already produced their addresses) when "-target" arguments are present.
+type TargetsTransformer struct {
+	// Targets is the raw list of targets as given on the command line,
+	// such as via repeated "-target=..." options.
+	Targets []string
+}
+
+func (t *TargetsTransformer) Transform(g *Graph) error {
+	if len(t.Targets) == 0 {
+		// Nothing to do; every vertex stays.
+		return nil
+	}
+
+	addrsTargets := make([]addrs.Targetable, 0, len(t.Targets))
+	for _, target := range t.Targets {
+		addr, diags := addrs.ParseTargetStr(target)
+		if diags.HasErrors() {
+			return fmt.Errorf("invalid target %q: %s", target, diags.Err())
+		}
+		addrsTargets = append(addrsTargets, addr)
+	}
+
+	for _, v := range g.Vertices() {
+		tn, ok := v.(GraphNodeTargetable)
+		if !ok {
+			// Nodes that don't have a targetable address (providers,
+			// provisioners, meta-nodes, etc.) are always retained; they
+			// will be pruned later if they end up with no remaining
+			// dependents.
+			continue
+		}
+
+		if !anyTargetContains(addrsTargets, tn.TargetableAddrs()) {
+			log.Printf("[DEBUG] TargetsTransformer: removing %q, not targeted", dag.VertexName(v))
+			g.Remove(v)
+		}
+	}
+
+	return nil
+}
+
+func anyTargetContains(targets []addrs.Targetable, candidates []addrs.Targetable) bool {
+	for _, target := range targets {
+		for _, addr := range candidates {
+			if target.TargetContains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}